@@ -0,0 +1,13 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package keystore builds the init container and hot-reload sidecar that load secure settings
+// into an Elasticsearch, Kibana or APM Server keystore. It owns the container/volume construction
+// and script generation; it is the Elasticsearch, Kibana and APM Server controllers' job to
+// populate InitContainerParameters/ReloaderContainerParameters from their respective CRD specs
+// (including the `secureSettings` field, cloud secret manager references, per-key encoding/alias
+// overrides, and the operator-wide RestrictedSecurityContextEnvVar flag) and to attach the
+// resulting corev1.Container and corev1.Volume values, via InitContainer and ReloaderContainer,
+// to their pod templates.
+package keystore
@@ -6,16 +6,51 @@ package keystore
 
 import (
 	"bytes"
+	"fmt"
+	"strconv"
 	"text/template"
 
-	"github.com/elastic/cloud-on-k8s/pkg/controller/common/volume"
 	corev1 "k8s.io/api/core/v1"
 )
 
 const (
 	InitContainerName = "elastic-internal-init-keystore"
+
+	// cloudSecretsDirName is the subdirectory of DataVolumePath that secure settings fetched from
+	// an external cloud secret manager are written to before being added to the keystore. It must
+	// live under the (writable) data volume, not the container's root filesystem, which may be
+	// read-only when RestrictedSecurityContext is enabled.
+	cloudSecretsDirName = "elastic-internal-cloud-secrets"
 )
 
+// CloudSecretProvider identifies an external cloud secret manager that can supply secure settings.
+type CloudSecretProvider string
+
+const (
+	AWSSecretsManager CloudSecretProvider = "aws-secrets-manager"
+	AzureKeyVault     CloudSecretProvider = "azure-key-vault"
+	GCPSecretManager  CloudSecretProvider = "gcp-secret-manager"
+)
+
+// CloudSecretObject references a single secret object to fetch from a CloudSecretsSource's provider.
+type CloudSecretObject struct {
+	// Name is the object identifier as known to the provider (secret ARN, vault secret URI, resource name, etc.)
+	Name string
+	// Key is the name under which the fetched value is added to the keystore.
+	Key string
+}
+
+// CloudSecretsSource describes an external cloud secret manager to fetch secure settings from,
+// in addition to the Kubernetes Secret mounted at SecureSettingsVolumeMountPath.
+type CloudSecretsSource struct {
+	// Provider identifies which cloud secret manager to query.
+	Provider CloudSecretProvider
+	// RoleARN is the IAM role (AWS) or workload identity (Azure/GCP) assumed to access the provider.
+	RoleARN string
+	// Objects lists the individual secrets to fetch from the provider.
+	Objects []CloudSecretObject
+}
+
 // InitContainerParameters helps to create a valid keystore init script for Kibana or the APM server.
 type InitContainerParameters struct {
 	// Where the user provided secured settings should be mounted
@@ -28,10 +63,35 @@ type InitContainerParameters struct {
 	KeystoreCreateCommand string
 	// Resources for the init container
 	Resources corev1.ResourceRequirements
+	// CloudSecretsSources lists external cloud secret managers to fetch additional secure settings from
+	CloudSecretsSources []CloudSecretsSource
+	// SecureSettingsSources lists the Secrets and ConfigMaps to merge into the secure settings volume
+	SecureSettingsSources []SecureSettingsSource
+	// RestrictedSecurityContext, when enabled through the operator-wide RestrictedSecurityContextEnvVar
+	// flag, makes the init container comply with the Kubernetes "restricted" Pod Security Standard.
+	RestrictedSecurityContext bool
+	// RunAsUser and RunAsGroup are the UID/GID the init container runs as when
+	// RestrictedSecurityContext is enabled. They must match the target product's image.
+	RunAsUser  *int64
+	RunAsGroup *int64
+	// KeyMetadata carries per-key encoding and alias overrides, keyed by the secure settings
+	// Secret key (or CloudSecretObject.Key for cloud-fetched entries).
+	KeyMetadata map[string]KeyMetadata
+}
+
+// templateParams is the data passed to scriptTemplate: InitContainerParameters plus the
+// generated bash fragment that fetches entries from any configured cloud secret managers.
+type templateParams struct {
+	InitContainerParameters
+	CloudSecretsDir       string
+	CloudSecretsFetchCmd  string
+	CloudSecretsKeyScript string
+	KeyMetadataScript     string
 }
 
 // script is a small bash script to create a Kibana or APM keystore,
-// then add all entries from the secure settings secret volume into it.
+// then add all entries from the secure settings secret volume and any configured
+// cloud secret managers into it.
 const script = `#!/usr/bin/env bash
 
 set -eux
@@ -41,10 +101,27 @@ echo "Initializing keystore."
 # create a keystore in the default data path
 {{ .KeystoreCreateCommand }}
 
-# add all existing secret entries into it
-for filename in  {{ .SecureSettingsVolumeMountPath }}/*; do
+{{ if .CloudSecretsFetchCmd }}
+# fetch entries from the configured cloud secret managers into {{ .CloudSecretsDir }}
+mkdir -p "{{ .CloudSecretsDir }}"
+{{ .CloudSecretsFetchCmd }}
+{{ end }}
+
+# add all existing secret entries into it, from the secret volume and any fetched cloud secrets
+for filename in  {{ .SecureSettingsVolumeMountPath }}/* {{ .CloudSecretsDir }}/*; do
 	[[ -e "$filename" ]] || continue # glob does not match
 	key=$(basename "$filename")
+{{ if .CloudSecretsKeyScript }}
+	# cloud secret objects are fetched to a numeric filename (see cloudSecretsFetchCommand), so
+	# $key above is that number, not the real CloudSecretObject.Key; resolve it back here, before
+	# anything below looks $key up in KeyMetadata.
+	if [[ "$(dirname "$filename")" == "{{ .CloudSecretsDir }}" ]]; then
+{{ .CloudSecretsKeyScript }}
+	fi
+{{ end }}
+	decoded="$filename"
+{{ .KeyMetadataScript }}
+	filename="$decoded"
 	echo "Adding "$key" to the keystore."
 	{{ .KeystoreAddCommand }}
 done
@@ -54,23 +131,98 @@ echo "Keystore initialization successful."
 
 var scriptTemplate = template.Must(template.New("").Parse(script))
 
-// initContainer returns an init container that executes a bash script
-// to load secure settings in a Keystore.
-func initContainer(
-	secureSettingsSecret volume.SecretVolume,
+// cloudSecretsFetchCommand renders the bash snippet that fetches every object of source via the
+// provider's CLI and writes it under cloudSecretsDir. source.Objects and source.RoleARN come
+// straight from the CR spec, so every value is shell-quoted before being written into the script.
+// Unlike a Kubernetes Secret key, CloudSecretObject.Key may contain "/" (eg. "prod/db/password",
+// an ordinary cloud secret manager naming convention) and isn't guaranteed unique across sources,
+// so objects aren't written to a file derived from Key: that would let two differently-named
+// objects collide on the same sanitized basename and silently clobber each other. Instead each
+// object is fetched to cloudSecretsDir/<startIndex+i>, a destination that can never collide, and
+// cloudSecretsKeyScript maps that index back to the real Key once the script runs.
+func cloudSecretsFetchCommand(source CloudSecretsSource, cloudSecretsDir string, startIndex int) string {
+	buf := bytes.Buffer{}
+	for i, object := range source.Objects {
+		dest := shellQuote(cloudSecretsDir + "/" + strconv.Itoa(startIndex+i))
+		switch source.Provider {
+		case AWSSecretsManager:
+			buf.WriteString(fmt.Sprintf(
+				"aws secretsmanager get-secret-value --secret-id %s --role-arn %s --query SecretString --output text > %s\n",
+				shellQuote(object.Name), shellQuote(source.RoleARN), dest))
+		case AzureKeyVault:
+			buf.WriteString(fmt.Sprintf(
+				"az keyvault secret show --id %s --query value --output tsv > %s\n",
+				shellQuote(object.Name), dest))
+		case GCPSecretManager:
+			buf.WriteString(fmt.Sprintf(
+				"gcloud secrets versions access latest --secret=%s > %s\n",
+				shellQuote(object.Name), dest))
+		}
+	}
+	return buf.String()
+}
+
+// cloudSecretsKeyScript renders the bash snippet that, for a file fetched from a cloud secret
+// manager, maps the numeric destination name cloudSecretsFetchCommand assigned it back to the
+// real CloudSecretObject.Key -- the name the object is actually added to the keystore under, and
+// the value KeyMetadata (encoding/alias overrides) is keyed by. It expects $key to hold the
+// numeric destination name, and reassigns it. Indices are assigned in the same order as
+// cloudSecretsFetchCommand: sources, then objects within each source.
+func cloudSecretsKeyScript(sources []CloudSecretsSource) string {
+	buf := bytes.Buffer{}
+	index := 0
+	for _, source := range sources {
+		for _, object := range source.Objects {
+			buf.WriteString(fmt.Sprintf("\t%s) key=%s ;;\n", shellQuote(strconv.Itoa(index)), shellQuote(object.Key)))
+			index++
+		}
+	}
+	if index == 0 {
+		return ""
+	}
+	// a single case statement, so a resolved Key that happens to look like a later index is not
+	// remapped a second time
+	return "\tcase \"$key\" in\n" + buf.String() + "\tesac\n"
+}
+
+// InitContainer returns an init container that executes a bash script to load secure settings
+// in a Keystore, and the projected volume it reads them from (if any sources were configured).
+// Elasticsearch, Kibana and APM Server controllers call this to attach the container (and, if
+// non-nil, the returned volume) to their pod templates.
+func InitContainer(
 	volumePrefix string,
 	parameters InitContainerParameters,
-) (corev1.Container, error) {
-	privileged := false
+) (corev1.Container, *corev1.Volume, error) {
 	tplBuffer := bytes.Buffer{}
 
-	if err := scriptTemplate.Execute(&tplBuffer, parameters); err != nil {
-		return corev1.Container{}, err
+	cloudSecretsDir := parameters.DataVolumePath + "/" + cloudSecretsDirName
+
+	fetchCmd := bytes.Buffer{}
+	index := 0
+	for _, source := range parameters.CloudSecretsSources {
+		fetchCmd.WriteString(cloudSecretsFetchCommand(source, cloudSecretsDir, index))
+		index += len(source.Objects)
+	}
+
+	params := templateParams{
+		InitContainerParameters: parameters,
+		CloudSecretsDir:         cloudSecretsDir,
+		CloudSecretsFetchCmd:    fetchCmd.String(),
+		CloudSecretsKeyScript:   cloudSecretsKeyScript(parameters.CloudSecretsSources),
+		KeyMetadataScript:       keyMetadataScript(parameters.KeyMetadata, parameters.DataVolumePath),
 	}
 
-	volumeMounts := []corev1.VolumeMount{
+	if err := scriptTemplate.Execute(&tplBuffer, params); err != nil {
+		return corev1.Container{}, nil, err
+	}
+
+	var volumeMounts []corev1.VolumeMount
+	var secureSettingsVol *corev1.Volume
+
+	if vol, ok := projectedSecureSettingsVolume(parameters.SecureSettingsSources); ok {
+		secureSettingsVol = &vol
 		// access secure settings
-		secureSettingsSecret.VolumeMount(),
+		volumeMounts = append(volumeMounts, secureSettingsVolumeMount(parameters.SecureSettingsVolumeMountPath))
 	}
 
 	// caller might be already taking care of the right mount and volume
@@ -83,11 +235,9 @@ func initContainer(
 		// Image will be inherited from pod template defaults Kibana Docker image
 		ImagePullPolicy: corev1.PullIfNotPresent,
 		Name:            InitContainerName,
-		SecurityContext: &corev1.SecurityContext{
-			Privileged: &privileged,
-		},
-		Command:      []string{"/usr/bin/env", "bash", "-c", tplBuffer.String()},
-		VolumeMounts: volumeMounts,
-		Resources:    parameters.Resources,
-	}, nil
+		SecurityContext: securityContext(parameters.RestrictedSecurityContext, parameters.RunAsUser, parameters.RunAsGroup),
+		Command:         []string{"/usr/bin/env", "bash", "-c", tplBuffer.String()},
+		VolumeMounts:    volumeMounts,
+		Resources:       parameters.Resources,
+	}, secureSettingsVol, nil
 }
@@ -0,0 +1,116 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package keystore
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// TestCloudSecretsFetchCommandQuotesUntrustedValues actually executes the generated bash snippet
+// (the provider CLI calls themselves are expected to fail since none are installed; that's fine,
+// the point is that the CR-spec-sourced payload must not be able to run anything of its own).
+func TestCloudSecretsFetchCommandQuotesUntrustedValues(t *testing.T) {
+	marker := filepath.Join(t.TempDir(), "pwned")
+	payload := "$(touch " + marker + ")"
+
+	source := CloudSecretsSource{
+		Provider: AWSSecretsManager,
+		RoleARN:  payload,
+		Objects: []CloudSecretObject{
+			{Name: payload, Key: "my-key"},
+		},
+	}
+
+	script := cloudSecretsFetchCommand(source, t.TempDir(), 0)
+
+	cmd := exec.Command("bash", "-c", script)
+	_ = cmd.Run() // the aws CLI isn't installed; we only care whether the injection ran
+
+	if _, err := os.Stat(marker); err == nil {
+		t.Fatalf("command substitution in a CR-sourced value executed, got script:\n%s", script)
+	}
+}
+
+// TestCloudSecretsFetchCommandDestinationsNeverCollide guards against two objects with Keys that
+// share a path.Base (or that simply are identical, a realistic cloud secret manager naming
+// convention, e.g. "prod/db/password" and "staging/db/password") silently clobbering each other's
+// fetched file before the keystore add loop even runs.
+func TestCloudSecretsFetchCommandDestinationsNeverCollide(t *testing.T) {
+	source := CloudSecretsSource{
+		Provider: GCPSecretManager,
+		Objects: []CloudSecretObject{
+			{Name: "prod-secret", Key: "prod/db/password"},
+			{Name: "staging-secret", Key: "staging/db/password"},
+			{Name: "traversal-secret", Key: "../../etc/cron.d/pwned"},
+		},
+	}
+
+	got := cloudSecretsFetchCommand(source, "/data/cloud-secrets", 0)
+
+	if strings.Contains(got, "..") {
+		t.Fatalf("expected every destination to be confined to the cloud secrets dir, got:\n%s", got)
+	}
+	for _, want := range []string{"/data/cloud-secrets/0", "/data/cloud-secrets/1", "/data/cloud-secrets/2"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected each object to get its own non-colliding destination, got:\n%s\nmissing: %s", got, want)
+		}
+	}
+}
+
+func TestCloudSecretsFetchCommandPerProvider(t *testing.T) {
+	tests := []struct {
+		provider CloudSecretProvider
+		want     string
+	}{
+		{provider: AWSSecretsManager, want: "aws secretsmanager get-secret-value"},
+		{provider: AzureKeyVault, want: "az keyvault secret show"},
+		{provider: GCPSecretManager, want: "gcloud secrets versions access"},
+	}
+	for _, tc := range tests {
+		t.Run(string(tc.provider), func(t *testing.T) {
+			source := CloudSecretsSource{
+				Provider: tc.provider,
+				Objects:  []CloudSecretObject{{Name: "my-secret", Key: "my-key"}},
+			}
+			got := cloudSecretsFetchCommand(source, "/data/cloud-secrets", 3)
+			if !strings.Contains(got, tc.want) {
+				t.Errorf("expected fetch command to contain %q, got:\n%s", tc.want, got)
+			}
+			if !strings.Contains(got, "/data/cloud-secrets/3") {
+				t.Errorf("expected fetch command to write into the cloud secrets dir at its assigned index, got:\n%s", got)
+			}
+		})
+	}
+}
+
+// TestCloudSecretsKeyScriptResolvesRealKey guards against KeyMetadata overrides (or the entry
+// name itself) silently never applying to cloud-fetched objects: the init script's $key starts
+// out as the numeric destination filename, not the real CloudSecretObject.Key, so something has
+// to map it back before KeyMetadataScript or KeystoreAddCommand ever see it.
+func TestCloudSecretsKeyScriptResolvesRealKey(t *testing.T) {
+	sources := []CloudSecretsSource{
+		{Provider: AWSSecretsManager, Objects: []CloudSecretObject{{Name: "a", Key: "prod/db/password"}}},
+		{Provider: GCPSecretManager, Objects: []CloudSecretObject{{Name: "b", Key: "staging/db/password"}}},
+	}
+
+	caseStatement := cloudSecretsKeyScript(sources)
+
+	for i, want := range []string{"prod/db/password", "staging/db/password"} {
+		script := fmt.Sprintf("key=%q\n%sprintf '%%s' \"$key\"", strconv.Itoa(i), caseStatement)
+		out, err := exec.Command("bash", "-c", script).Output()
+		if err != nil {
+			t.Fatalf("failed to run generated script: %s", err)
+		}
+		if got := string(out); got != want {
+			t.Errorf("index %d resolved to %q, want %q", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package keystore
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// KeyEncoding identifies how a secure settings entry's content is stored on disk, so the init
+// container can decode it before adding it to the keystore.
+type KeyEncoding string
+
+const (
+	EncodingRaw    KeyEncoding = "raw"
+	EncodingBase64 KeyEncoding = "base64"
+	EncodingHex    KeyEncoding = "hex"
+	EncodingUTF8   KeyEncoding = "utf-8"
+)
+
+// KeyMetadata carries the encoding and optional alias for a single secure settings key, sourced
+// either from a keystore.k8s.elastic.co/<key>.{encoding,alias} annotation on the Secret, or from
+// a secureSettings entry on the CRD.
+type KeyMetadata struct {
+	// Encoding the entry's content is stored in. Defaults to EncodingRaw if empty.
+	Encoding KeyEncoding
+	// Alias is the name used inside the keystore, if different from the source key name.
+	Alias string
+}
+
+// KeyMetadataAnnotationPrefix namespaces the per-key encoding/alias annotations that can be set
+// on a secure settings Secret, eg. "keystore.k8s.elastic.co/mykey.encoding: base64".
+const KeyMetadataAnnotationPrefix = "keystore.k8s.elastic.co/"
+
+// ParseKeyMetadataAnnotations extracts per-key KeyMetadata from a secure settings Secret's
+// annotations, recognizing the "<prefix><key>.encoding" and "<prefix><key>.alias" annotations.
+func ParseKeyMetadataAnnotations(annotations map[string]string) map[string]KeyMetadata {
+	metadata := map[string]KeyMetadata{}
+	for annotation, value := range annotations {
+		rest := strings.TrimPrefix(annotation, KeyMetadataAnnotationPrefix)
+		if rest == annotation {
+			continue // annotation didn't have the prefix
+		}
+
+		dot := strings.LastIndexByte(rest, '.')
+		if dot < 0 {
+			continue
+		}
+		key, field := rest[:dot], rest[dot+1:]
+
+		m := metadata[key]
+		switch field {
+		case "encoding":
+			m.Encoding = KeyEncoding(value)
+		case "alias":
+			m.Alias = value
+		default:
+			continue
+		}
+		metadata[key] = m
+	}
+	return metadata
+}
+
+// keyMetadataScript renders the bash snippet that, for each key with KeyMetadata, decodes its
+// content into the data volume and/or renames it to its alias before it is added to the
+// keystore. It expects $filename and $key to already be set in scope, and may reassign both.
+func keyMetadataScript(metadata map[string]KeyMetadata, dataVolumePath string) string {
+	if len(metadata) == 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// key and alias come from Secret keys/annotations, and dataVolumePath is operator-controlled,
+	// but all three are shell-quoted rather than Go-%q-escaped: %q only escapes Go string syntax,
+	// not shell syntax, and would let a crafted key/alias break out of the generated script.
+	buf := bytes.Buffer{}
+	buf.WriteString("\tcase \"$key\" in\n")
+	for i, key := range keys {
+		m := metadata[key]
+		buf.WriteString(fmt.Sprintf("\t%s)\n", shellQuote(key)))
+		// Decode into a path keyed on this entry's position in the sorted key list, rather than a
+		// fresh mktemp file, so that re-running this script on every reconcile (the reloader
+		// sidecar does, unlike the one-shot init container) overwrites the same file instead of
+		// leaking one per cycle. The index is used instead of the key itself because, unlike a
+		// Kubernetes Secret key, a CloudSecretObject.Key may contain "/" and isn't guaranteed to
+		// produce a unique basename once sanitized for use in a path.
+		decodedPath := fmt.Sprintf("%s/.elastic-internal-keystore-decoded-%d", dataVolumePath, i)
+		switch m.Encoding {
+		case EncodingBase64:
+			buf.WriteString(fmt.Sprintf("\t\tdecoded=%s\n\t\tbase64 -d \"$filename\" > \"$decoded\"\n\t\tfilename=\"$decoded\"\n", shellQuote(decodedPath)))
+		case EncodingHex:
+			buf.WriteString(fmt.Sprintf("\t\tdecoded=%s\n\t\txxd -r -p \"$filename\" > \"$decoded\"\n\t\tfilename=\"$decoded\"\n", shellQuote(decodedPath)))
+		case EncodingRaw, EncodingUTF8, "":
+			// content is already in its final form, nothing to decode
+		}
+		if m.Alias != "" {
+			buf.WriteString(fmt.Sprintf("\t\tkey=%s\n", shellQuote(m.Alias)))
+		}
+		buf.WriteString("\t\t;;\n")
+	}
+	buf.WriteString("\tesac\n")
+	return buf.String()
+}
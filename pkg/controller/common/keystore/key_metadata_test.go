@@ -0,0 +1,93 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package keystore
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseKeyMetadataAnnotations(t *testing.T) {
+	annotations := map[string]string{
+		KeyMetadataAnnotationPrefix + "mykey.encoding": "base64",
+		KeyMetadataAnnotationPrefix + "mykey.alias":    "my-alias",
+		KeyMetadataAnnotationPrefix + "otherkey.alias": "other-alias",
+		KeyMetadataAnnotationPrefix + "otherkey.bogus": "ignored",
+		"unrelated-annotation":                         "ignored",
+	}
+
+	got := ParseKeyMetadataAnnotations(annotations)
+
+	want := map[string]KeyMetadata{
+		"mykey":    {Encoding: EncodingBase64, Alias: "my-alias"},
+		"otherkey": {Alias: "other-alias"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d keys, want %d: %+v", len(got), len(want), got)
+	}
+	for key, wantMeta := range want {
+		if got[key] != wantMeta {
+			t.Errorf("metadata[%q] = %+v, want %+v", key, got[key], wantMeta)
+		}
+	}
+}
+
+// TestKeyMetadataScriptQuotesUntrustedValues actually runs the generated case statement in bash
+// with an alias crafted to run a command if it were interpolated unsafely (the original bug used
+// fmt.Sprintf("%q", alias), which only escapes Go string syntax, not shell syntax).
+func TestKeyMetadataScriptQuotesUntrustedValues(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "pwned")
+	payload := "$(touch " + marker + ")"
+
+	metadata := map[string]KeyMetadata{
+		"origkey": {Alias: payload},
+	}
+
+	caseStatement := keyMetadataScript(metadata, dir)
+	script := `key="origkey"
+filename=/dev/null
+decoded="$filename"
+` + caseStatement + `
+filename="$decoded"
+printf '%s' "$key"
+`
+
+	out, err := exec.Command("bash", "-c", script).Output()
+	if err != nil {
+		t.Fatalf("failed to run generated script: %s", err)
+	}
+
+	if _, statErr := os.Stat(marker); statErr == nil {
+		t.Fatalf("command substitution in an annotation-sourced alias executed, got script:\n%s", script)
+	}
+	if got := string(out); got != payload {
+		t.Fatalf("alias should be used verbatim, got %q, want %q", got, payload)
+	}
+}
+
+// TestKeyMetadataScriptReusesDecodedPath guards against a decoded-entry temp file leaking once per
+// reconcile cycle: the reloader sidecar re-runs this script on every reload, so a fresh mktemp
+// file per cycle would accumulate forever on the data volume.
+func TestKeyMetadataScriptReusesDecodedPath(t *testing.T) {
+	first := keyMetadataScript(map[string]KeyMetadata{"mykey": {Encoding: EncodingBase64}}, "/data")
+	second := keyMetadataScript(map[string]KeyMetadata{"mykey": {Encoding: EncodingBase64}}, "/data")
+
+	if strings.Contains(first, "mktemp") {
+		t.Fatalf("expected no mktemp call, got script:\n%s", first)
+	}
+	if first != second {
+		t.Fatalf("expected the decoded path to be deterministic across reconcile cycles, got:\n%s\nvs:\n%s", first, second)
+	}
+}
+
+func TestKeyMetadataScriptEmpty(t *testing.T) {
+	if got := keyMetadataScript(nil, "/data"); got != "" {
+		t.Errorf("expected no metadata to produce an empty script, got %q", got)
+	}
+}
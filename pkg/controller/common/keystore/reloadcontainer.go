@@ -0,0 +1,189 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package keystore
+
+import (
+	"bytes"
+	"text/template"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	ReloaderContainerName = "elastic-internal-keystore-reloader"
+
+	// DefaultReloadDebounce is how long the reloader waits for the secure settings volume to
+	// go quiet before reconciling the keystore, to coalesce a burst of changes into one reload.
+	DefaultReloadDebounce = 2 * time.Second
+
+	// knownKeysFilename tracks the keystore keys added during the last reconciliation, so a key
+	// removed from the secure settings Secret can be detected and removed from the keystore too.
+	knownKeysFilename = ".elastic-internal-keystore-known-keys"
+)
+
+// ReloaderContainerParameters helps to create a sidecar that keeps a keystore in sync with its
+// backing secure settings volume, reconciling and reloading it whenever the volume changes.
+type ReloaderContainerParameters struct {
+	// Where the user provided secure settings are mounted
+	SecureSettingsVolumeMountPath string
+	// Where the keystore lives
+	DataVolumePath string
+	// Keystore create/add/remove commands
+	KeystoreCreateCommand string
+	KeystoreAddCommand    string
+	KeystoreRemoveCommand string
+	// ReloadCommand is the per-product hook called after the keystore has been reconciled,
+	// typically a curl call to the product's secure settings reload endpoint
+	// (eg. ES's `_nodes/reload_secure_settings`).
+	ReloadCommand string
+	// Debounce is how long to wait for the volume to go quiet before reconciling.
+	// Defaults to DefaultReloadDebounce when zero.
+	Debounce time.Duration
+	// Resources for the reloader container
+	Resources corev1.ResourceRequirements
+	// SecureSettingsSources lists the Secrets and ConfigMaps to merge into the secure settings volume
+	SecureSettingsSources []SecureSettingsSource
+	// RestrictedSecurityContext, when enabled through the operator-wide RestrictedSecurityContextEnvVar
+	// flag, makes the reloader container comply with the Kubernetes "restricted" Pod Security Standard.
+	RestrictedSecurityContext bool
+	// RunAsUser and RunAsGroup are the UID/GID the reloader container runs as when
+	// RestrictedSecurityContext is enabled. They must match the target product's image.
+	RunAsUser  *int64
+	RunAsGroup *int64
+	// KeyMetadata carries per-key encoding and alias overrides, keyed by the secure settings
+	// Secret key. Must match InitContainerParameters.KeyMetadata so a key added with a given
+	// encoding/alias by the init container is kept in sync the same way on every reload.
+	KeyMetadata map[string]KeyMetadata
+}
+
+// reloadScript watches the secure settings volume for changes, and on each change reconciles
+// the keystore: entries added or updated in the volume are (re-)added, entries removed from the
+// volume are removed from the keystore, then the product's reload endpoint is called.
+const reloadScript = `#!/usr/bin/env bash
+
+set -eu
+
+echo "Starting keystore reloader."
+
+{{ .KeystoreCreateCommand }}
+
+known_keys_file="{{ .DataVolumePath }}/` + knownKeysFilename + `"
+touch "$known_keys_file"
+
+reconcile() {
+	echo "Reconciling keystore from {{ .SecureSettingsVolumeMountPath }}."
+	# write temp state under the (writable) data volume rather than a possibly read-only /tmp
+	current_keys=$(mktemp -p "{{ .DataVolumePath }}")
+
+	for filename in {{ .SecureSettingsVolumeMountPath }}/*; do
+		[[ -e "$filename" ]] || continue # glob does not match
+		origkey=$(basename "$filename")
+		key="$origkey"
+		decoded="$filename"
+{{ .KeyMetadataScript }}
+		filename="$decoded"
+		printf '%s\t%s\n' "$origkey" "$key" >> "$current_keys"
+		echo "Adding "$key" to the keystore."
+		{{ .KeystoreAddCommand }}
+	done
+
+	while IFS=$'\t' read -r origkey key; do
+		[[ -z "$origkey" ]] && continue
+		current_key=$(awk -F '\t' -v k="$origkey" '$1 == k { print $2; exit }' "$current_keys")
+		if [[ -z "$current_key" ]]; then
+			echo "Removing "$key" from the keystore."
+			{{ .KeystoreRemoveCommand }}
+		elif [[ "$current_key" != "$key" ]]; then
+			# same source file, but its alias changed since the last reconcile: the add loop above
+			# already (re-)added it under $current_key, so only the stale old alias needs removing.
+			echo "Removing stale alias "$key" from the keystore after rename to "$current_key"."
+			{{ .KeystoreRemoveCommand }}
+		fi
+	done < "$known_keys_file"
+
+	mv "$current_keys" "$known_keys_file"
+
+	echo "Reloading secure settings."
+	{{ .ReloadCommand }}
+}
+
+reconcile
+
+while true; do
+	inotifywait -q -r -e modify,create,delete,move,close_write {{ .SecureSettingsVolumeMountPath }} >/dev/null
+	# debounce: keep draining events until the volume goes quiet, to coalesce a burst of changes
+	while inotifywait -q -t {{ .DebounceSeconds }} -r -e modify,create,delete,move,close_write {{ .SecureSettingsVolumeMountPath }} >/dev/null 2>&1; do
+		:
+	done
+	reconcile
+done
+`
+
+var reloadScriptTemplate = template.Must(template.New("").Parse(reloadScript))
+
+// debounceSeconds converts d to the whole seconds inotifywait's -t flag expects, defaulting to
+// DefaultReloadDebounce when d is unset and flooring at 1: inotifywait treats a timeout of 0 as
+// "wait forever", so a sub-second d must never truncate down to 0.
+func debounceSeconds(d time.Duration) int {
+	if d <= 0 {
+		d = DefaultReloadDebounce
+	}
+	if seconds := int(d.Seconds()); seconds >= 1 {
+		return seconds
+	}
+	return 1
+}
+
+// reloadTemplateParams is the data passed to reloadScriptTemplate.
+type reloadTemplateParams struct {
+	ReloaderContainerParameters
+	DebounceSeconds   int
+	KeyMetadataScript string
+}
+
+// ReloaderContainer returns a sidecar container that watches the secure settings volume and
+// reconciles the keystore whenever it changes, calling ReloadCommand after each reconciliation,
+// along with the projected volume it reads secure settings from (if any sources were configured).
+// Elasticsearch, Kibana and APM Server controllers call this alongside InitContainer to attach
+// the hot-reload sidecar (and, if non-nil, the returned volume) to their pod templates.
+func ReloaderContainer(
+	volumePrefix string,
+	parameters ReloaderContainerParameters,
+) (corev1.Container, *corev1.Volume, error) {
+	tplBuffer := bytes.Buffer{}
+
+	params := reloadTemplateParams{
+		ReloaderContainerParameters: parameters,
+		DebounceSeconds:             debounceSeconds(parameters.Debounce),
+		KeyMetadataScript:           keyMetadataScript(parameters.KeyMetadata, parameters.DataVolumePath),
+	}
+
+	if err := reloadScriptTemplate.Execute(&tplBuffer, params); err != nil {
+		return corev1.Container{}, nil, err
+	}
+
+	var secureSettingsVol *corev1.Volume
+	volumeMounts := []corev1.VolumeMount{
+		// read and write the keystore
+		DataVolume(volumePrefix, parameters.DataVolumePath).VolumeMount(),
+	}
+
+	if vol, ok := projectedSecureSettingsVolume(parameters.SecureSettingsSources); ok {
+		secureSettingsVol = &vol
+		// watch secure settings for changes
+		volumeMounts = append(volumeMounts, secureSettingsVolumeMount(parameters.SecureSettingsVolumeMountPath))
+	}
+
+	return corev1.Container{
+		// Image will be inherited from pod template defaults
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Name:            ReloaderContainerName,
+		SecurityContext: securityContext(parameters.RestrictedSecurityContext, parameters.RunAsUser, parameters.RunAsGroup),
+		Command:         []string{"/usr/bin/env", "bash", "-c", tplBuffer.String()},
+		VolumeMounts:    volumeMounts,
+		Resources:       parameters.Resources,
+	}, secureSettingsVol, nil
+}
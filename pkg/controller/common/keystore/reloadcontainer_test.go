@@ -0,0 +1,134 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package keystore
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDebounceSecondsNeverReturnsANonPositiveTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		in   time.Duration
+		want int
+	}{
+		{name: "unset defaults", in: 0, want: int(DefaultReloadDebounce.Seconds())},
+		{name: "negative defaults", in: -time.Second, want: int(DefaultReloadDebounce.Seconds())},
+		{name: "sub-second floors to 1, not 0", in: 500 * time.Millisecond, want: 1},
+		{name: "1ns floors to 1, not 0", in: time.Nanosecond, want: 1},
+		{name: "whole seconds pass through", in: 5 * time.Second, want: 5},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := debounceSeconds(tc.in); got != tc.want {
+				t.Errorf("debounceSeconds(%s) = %d, want %d", tc.in, got, tc.want)
+			}
+			if got := debounceSeconds(tc.in); got < 1 {
+				t.Errorf("debounceSeconds(%s) = %d, inotifywait would treat this as no timeout", tc.in, got)
+			}
+		})
+	}
+}
+
+// TestReloadScriptAppliesKeyMetadataOnEveryReconcile guards against the KeyMetadataScript fragment
+// being dropped from the reload loop, which would make the chunk0-2 sidecar silently re-add a
+// key raw and under its original name on every reload after the init container's first pass.
+func TestReloadScriptAppliesKeyMetadataOnEveryReconcile(t *testing.T) {
+	params := reloadTemplateParams{
+		ReloaderContainerParameters: ReloaderContainerParameters{
+			SecureSettingsVolumeMountPath: "/mnt/secure-settings",
+			DataVolumePath:                "/data",
+			KeystoreCreateCommand:         "create-keystore",
+			KeystoreAddCommand:            "add-to-keystore",
+			KeystoreRemoveCommand:         "remove-from-keystore",
+			ReloadCommand:                 "reload",
+		},
+		DebounceSeconds:   1,
+		KeyMetadataScript: keyMetadataScript(map[string]KeyMetadata{"mykey": {Encoding: EncodingBase64, Alias: "my-alias"}}, "/data"),
+	}
+
+	buf := bytes.Buffer{}
+	if err := reloadScriptTemplate.Execute(&buf, params); err != nil {
+		t.Fatalf("failed to render reload script: %s", err)
+	}
+	script := buf.String()
+
+	if !strings.Contains(script, "base64 -d") {
+		t.Errorf("expected the reconcile loop to decode base64 entries, got script:\n%s", script)
+	}
+	if !strings.Contains(script, shellQuote("my-alias")) {
+		t.Errorf("expected the reconcile loop to use the configured alias, got script:\n%s", script)
+	}
+}
+
+// TestReconcileRemovesStaleAliasOnRename actually runs the rendered reconcile() function, twice,
+// against a secure settings key whose alias changes between the two reconciles. It guards against
+// removal being keyed on the source filename alone, which would leave the entry added under the
+// first alias permanently orphaned in the keystore once the alias changes.
+func TestReconcileRemovesStaleAliasOnRename(t *testing.T) {
+	dataDir := t.TempDir()
+	secureDir := t.TempDir()
+	logFile := filepath.Join(t.TempDir(), "log")
+
+	if err := os.WriteFile(filepath.Join(secureDir, "mykey"), []byte("secret-value"), 0o600); err != nil {
+		t.Fatalf("failed to write secure settings file: %s", err)
+	}
+
+	params := reloadTemplateParams{
+		ReloaderContainerParameters: ReloaderContainerParameters{
+			SecureSettingsVolumeMountPath: secureDir,
+			DataVolumePath:                dataDir,
+			KeystoreCreateCommand:         "true",
+			KeystoreAddCommand:            "echo ADD \"$key\" >> " + shellQuote(logFile),
+			KeystoreRemoveCommand:         "echo REMOVE \"$key\" >> " + shellQuote(logFile),
+			ReloadCommand:                 "true",
+		},
+		DebounceSeconds: 1,
+	}
+
+	// runReconcile renders the real reload script for the given metadata, then runs it up to and
+	// including its one-shot call to reconcile() -- the trailing inotifywait loop is dropped so
+	// the test can drive successive reconciles itself instead of waiting on filesystem events.
+	runReconcile := func(metadata map[string]KeyMetadata) {
+		params.KeyMetadataScript = keyMetadataScript(metadata, dataDir)
+		buf := bytes.Buffer{}
+		if err := reloadScriptTemplate.Execute(&buf, params); err != nil {
+			t.Fatalf("failed to render reload script: %s", err)
+		}
+		full := buf.String()
+		cut := strings.Index(full, "\nreconcile\n\nwhile true")
+		if cut < 0 {
+			t.Fatalf("reload script template shape changed, update this test:\n%s", full)
+		}
+		script := full[:cut] + "\nreconcile\n"
+		if out, err := exec.Command("bash", "-c", script).CombinedOutput(); err != nil {
+			t.Fatalf("reconcile failed: %s\noutput:\n%s", err, out)
+		}
+	}
+
+	runReconcile(map[string]KeyMetadata{"mykey": {}})
+	runReconcile(map[string]KeyMetadata{"mykey": {Alias: "my-alias"}})
+
+	out, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("failed to read log file: %s", err)
+	}
+	log := string(out)
+	if !strings.Contains(log, "ADD mykey") {
+		t.Errorf("expected the first reconcile to add the key under its original name, got log:\n%s", log)
+	}
+	if !strings.Contains(log, "ADD my-alias") {
+		t.Errorf("expected the second reconcile to add the key under its new alias, got log:\n%s", log)
+	}
+	if !strings.Contains(log, "REMOVE mykey") {
+		t.Errorf("expected the second reconcile to remove the stale original-name entry, got log:\n%s", log)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package keystore
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// SecureSettingsVolumeName is the name of the projected volume combining all configured
+	// SecureSettingsSource entries, mounted at SecureSettingsVolumeMountPath.
+	SecureSettingsVolumeName = "elastic-internal-secure-settings"
+)
+
+// SecureSettingsSource references a single Secret or ConfigMap (not both) to merge into the
+// projected secure settings volume, mirroring the shape of corev1.VolumeProjection so several
+// sources (eg. an org-wide credentials Secret and a cluster-specific one) can be combined.
+type SecureSettingsSource struct {
+	// SecretName is the name of the Secret to project entries from.
+	SecretName string
+	// ConfigMapName is the name of the ConfigMap to project entries from.
+	ConfigMapName string
+	// Items remaps specific keys to paths within the mount. If empty, every key in the
+	// referenced Secret or ConfigMap is projected under its own name.
+	Items []corev1.KeyToPath
+}
+
+// projectedSecureSettingsVolume builds a single projected volume out of sources, to be mounted
+// with secureSettingsVolumeMount. It returns a zero-value Volume and false if sources is empty.
+func projectedSecureSettingsVolume(sources []SecureSettingsSource) (corev1.Volume, bool) {
+	if len(sources) == 0 {
+		return corev1.Volume{}, false
+	}
+
+	projections := make([]corev1.VolumeProjection, 0, len(sources))
+	for _, source := range sources {
+		switch {
+		case source.SecretName != "":
+			projections = append(projections, corev1.VolumeProjection{
+				Secret: &corev1.SecretProjection{
+					LocalObjectReference: corev1.LocalObjectReference{Name: source.SecretName},
+					Items:                source.Items,
+				},
+			})
+		case source.ConfigMapName != "":
+			projections = append(projections, corev1.VolumeProjection{
+				ConfigMap: &corev1.ConfigMapProjection{
+					LocalObjectReference: corev1.LocalObjectReference{Name: source.ConfigMapName},
+					Items:                source.Items,
+				},
+			})
+		}
+	}
+
+	return corev1.Volume{
+		Name: SecureSettingsVolumeName,
+		VolumeSource: corev1.VolumeSource{
+			Projected: &corev1.ProjectedVolumeSource{
+				Sources: projections,
+			},
+		},
+	}, true
+}
+
+// secureSettingsVolumeMount returns the VolumeMount corresponding to projectedSecureSettingsVolume,
+// mounted read-only at mountPath.
+func secureSettingsVolumeMount(mountPath string) corev1.VolumeMount {
+	return corev1.VolumeMount{
+		Name:      SecureSettingsVolumeName,
+		MountPath: mountPath,
+		ReadOnly:  true,
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package keystore
+
+import (
+	"os"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// RestrictedSecurityContextEnvVar is the operator-wide environment variable that enables the
+// restricted Pod Security Standard code path for the keystore init and reloader containers,
+// mirroring Tekton's set-security-context flag. Controllers should read it once at startup and
+// thread the result into InitContainerParameters.RestrictedSecurityContext and
+// ReloaderContainerParameters.RestrictedSecurityContext.
+const RestrictedSecurityContextEnvVar = "ENABLE_RESTRICTED_SECURITY_CONTEXT"
+
+// RestrictedSecurityContextEnabled reports whether RestrictedSecurityContextEnvVar is set to a
+// truthy value.
+func RestrictedSecurityContextEnabled() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv(RestrictedSecurityContextEnvVar))
+	return enabled
+}
+
+// Product identifies which Elastic Stack application a keystore container is running alongside,
+// so an appropriate non-root RunAsUser/RunAsGroup can be selected for it.
+type Product string
+
+const (
+	Elasticsearch Product = "elasticsearch"
+	Kibana        Product = "kibana"
+	APMServer     Product = "apm-server"
+)
+
+// defaultRunAsUser is the non-root UID/GID each product's Docker image runs as.
+var defaultRunAsUser = map[Product]int64{
+	Elasticsearch: 1000,
+	Kibana:        1000,
+	APMServer:     1000,
+}
+
+// DefaultRunAsUser returns the UID/GID to use for RestrictedSecurityContext's RunAsUser and
+// RunAsGroup for the given product, or nil if the product is unknown.
+func DefaultRunAsUser(product Product) *int64 {
+	uid, ok := defaultRunAsUser[product]
+	if !ok {
+		return nil
+	}
+	return &uid
+}
+
+// securityContext returns the SecurityContext to apply to the init and reloader containers.
+// When restricted is false (the default), it only sets Privileged to false, as before.
+// When restricted is true, it additionally satisfies the Kubernetes "restricted" Pod Security
+// Standard: privilege escalation is disabled, the root filesystem is read-only, all Linux
+// capabilities are dropped, and a non-root user is enforced. runAsUser and runAsGroup must be
+// set by the caller to a UID/GID valid for the target product's image (DefaultRunAsUser returns
+// the one for Elasticsearch, Kibana or APM Server).
+func securityContext(restricted bool, runAsUser, runAsGroup *int64) *corev1.SecurityContext {
+	privileged := false
+
+	if !restricted {
+		return &corev1.SecurityContext{
+			Privileged: &privileged,
+		}
+	}
+
+	allowPrivilegeEscalation := false
+	readOnlyRootFilesystem := true
+	runAsNonRoot := true
+
+	return &corev1.SecurityContext{
+		Privileged:               &privileged,
+		RunAsNonRoot:             &runAsNonRoot,
+		RunAsUser:                runAsUser,
+		RunAsGroup:               runAsGroup,
+		AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+		ReadOnlyRootFilesystem:   &readOnlyRootFilesystem,
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		},
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+}
@@ -0,0 +1,16 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package keystore
+
+import "strings"
+
+// shellQuote makes s safe to interpolate as a single word in the generated bash scripts.
+// Unlike fmt's %q (which only escapes Go string syntax), this produces a single-quoted bash
+// literal: embedded single quotes are closed, escaped, and reopened, and every other character
+// -- including $, `, and " -- is passed through inert. Always use this, never %q, for any
+// spec- or annotation-sourced string (CR fields, Secret keys/annotations) written into a script.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
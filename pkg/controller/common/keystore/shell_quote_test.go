@@ -0,0 +1,28 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package keystore
+
+import "testing"
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "plain", in: "foo", want: "'foo'"},
+		{name: "embedded single quote", in: "it's", want: `'it'\''s'`},
+		{name: "command substitution is neutralized", in: "$(touch /tmp/pwned)", want: `'$(touch /tmp/pwned)'`},
+		{name: "backtick is neutralized", in: "`touch /tmp/pwned`", want: "'`touch /tmp/pwned`'"},
+		{name: "empty", in: "", want: "''"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := shellQuote(tc.in); got != tc.want {
+				t.Errorf("shellQuote(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}